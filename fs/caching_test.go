@@ -22,13 +22,15 @@ import (
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/gcscaching"
+	"github.com/googlecloudplatform/gcsfuse/gcscaching/notifier"
 	"github.com/googlecloudplatform/gcsfuse/timeutil"
 	"github.com/jacobsa/fuse/fusetesting"
 	"github.com/jacobsa/gcloud/gcs"
-	"github.com/jacobsa/gcloud/gcs/gcscaching"
 	"github.com/jacobsa/gcloud/gcs/gcsutil"
 	. "github.com/jacobsa/oglematchers"
 	. "github.com/jacobsa/ogletest"
+	"golang.org/x/net/context"
 )
 
 ////////////////////////////////////////////////////////////////////////
@@ -441,3 +443,605 @@ func (t *cachingWithImplicitDirsTest) SymlinksAreTypeCached() {
 	ExpectEq("foo"+inode.ConflictingFileNameSuffix, fi.Name())
 	ExpectEq(filePerms|os.ModeSymlink, fi.Mode())
 }
+
+////////////////////////////////////////////////////////////////////////
+// Caching with change notifications
+////////////////////////////////////////////////////////////////////////
+
+// fakeNotifier is a notifier.Notifier that tests drive directly by calling
+// Notify, standing in for a real GCS Object Change Notification push
+// subscription so that tests can exercise sub-TTL invalidation
+// deterministically.
+type fakeNotifier struct {
+	events chan notifier.Event
+}
+
+func newFakeNotifier() *fakeNotifier {
+	return &fakeNotifier{
+		events: make(chan notifier.Event, 100),
+	}
+}
+
+func (fn *fakeNotifier) Subscribe(ctx context.Context) (<-chan notifier.Event, error) {
+	return fn.events, nil
+}
+
+// Notify simulates a GCS Object Change Notification arriving for the named
+// object in the mounted bucket.
+func (fn *fakeNotifier) Notify(name string) {
+	fn.events <- notifier.Event{Name: name}
+}
+
+// cachingWithNotifierTest exercises gcscaching.FastStatBucket.ListenForChanges
+// directly against a fakeNotifier, the same way persistentStatCacheTest
+// exercises the persistent cache: fs.ServerConfig.Notifier is not
+// subscribed by the server itself, so this suite calls ListenForChanges on a
+// bucket it builds and observes the effect deterministically, without
+// needing a full mounted file system.
+type cachingWithNotifierTest struct {
+	cachingTestCommon
+}
+
+func init() { registerSuitePrototype(&cachingWithNotifierTest{}) }
+
+func (t *cachingWithNotifierTest) bucketWithNotifier(
+	n notifier.Notifier) gcs.Bucket {
+	statCache := gcscaching.NewStatCache(1000)
+	bucket := gcscaching.NewFastStatBucket(ttl, statCache, t.clock, t.uncachedBucket)
+
+	AssertEq(nil, bucket.ListenForChanges(t.ctx, n))
+
+	return bucket
+}
+
+// awaitStatObject polls bucket.StatObject(name) until it matches want, for
+// up to a second, to give the background goroutine started by
+// ListenForChanges time to process an event.
+func awaitStatObject(
+	bucket gcs.Bucket,
+	ctx context.Context,
+	name string,
+	want func(o *gcs.Object, err error) bool) (o *gcs.Object, err error) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		o, err = bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: name})
+		if want(o, err) || time.Now().After(deadline) {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (t *cachingWithNotifierTest) FileChangedRemotely() {
+	const name = "foo"
+
+	_, err := gcsutil.CreateObject(t.ctx, t.uncachedBucket, name, "taco")
+	AssertEq(nil, err)
+
+	n := newFakeNotifier()
+	bucket := t.bucketWithNotifier(n)
+
+	o, err := bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	ExpectEq(len("taco"), o.Size)
+
+	// Overwrite the object in GCS.
+	_, err = gcsutil.CreateObject(t.ctx, t.uncachedBucket, name, "burrito")
+	AssertEq(nil, err)
+
+	// With no notification yet delivered, the cached version should still be
+	// returned, well within the TTL.
+	o, err = bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	ExpectEq(len("taco"), o.Size)
+
+	// A change notification for the object should invalidate the stat cache
+	// entry, without waiting for the TTL to elapse.
+	n.Notify(name)
+
+	o, err = awaitStatObject(bucket, t.ctx, name, func(o *gcs.Object, err error) bool {
+		return err == nil && o.Size == int64(len("burrito"))
+	})
+
+	AssertEq(nil, err)
+	ExpectEq(len("burrito"), o.Size)
+}
+
+func (t *cachingWithNotifierTest) DirectoryPlaceholderRemovedRemotely() {
+	const name = "foo/"
+
+	_, err := gcsutil.CreateObject(t.ctx, t.uncachedBucket, name, "")
+	AssertEq(nil, err)
+
+	n := newFakeNotifier()
+	bucket := t.bucketWithNotifier(n)
+
+	_, err = bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+
+	// Remove the backing object in GCS.
+	err = t.uncachedBucket.DeleteObject(t.ctx, name)
+	AssertEq(nil, err)
+
+	// Still cached, well within the TTL.
+	_, err = bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+
+	// A notification for the removed placeholder should invalidate the
+	// entry so that the next stat actually asks GCS and sees it's gone.
+	n.Notify(name)
+
+	_, err = awaitStatObject(bucket, t.ctx, name, func(o *gcs.Object, err error) bool {
+		_, notFound := err.(*gcs.NotFoundError)
+		return notFound
+	})
+
+	_, notFound := err.(*gcs.NotFoundError)
+	AssertTrue(notFound, "err: %v", err)
+}
+
+// TypeCacheEntryInvalidatedAlongsideStatEntry proves that a single
+// ListenForChanges subscription invalidates a gcscaching.TypeCache passed
+// to it at the same time as the stat cache, for a name keyed identically in
+// both (a regular file in the bucket root).
+func (t *cachingWithNotifierTest) TypeCacheEntryInvalidatedAlongsideStatEntry() {
+	const name = "foo"
+
+	statCache := gcscaching.NewStatCache(1000)
+	typeCache := gcscaching.NewTypeCache(1000)
+	bucket := gcscaching.NewFastStatBucket(ttl, statCache, t.clock, t.uncachedBucket)
+
+	n := newFakeNotifier()
+	AssertEq(nil, bucket.ListenForChanges(t.ctx, n, typeCache))
+
+	typeCache.Insert(name, gcscaching.RegularFileType, t.clock.Now().Add(ttl))
+
+	n.Notify(name)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := typeCache.LookUp(name, t.clock.Now()); !ok {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			AssertTrue(false, "type cache entry for %q was never invalidated", name)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Persistent stat cache
+////////////////////////////////////////////////////////////////////////
+
+// countingBucket wraps a gcs.Bucket, counting calls to StatObject so tests
+// can assert on how many requests actually reach GCS as opposed to being
+// served from a cache.
+type countingBucket struct {
+	gcs.Bucket
+	statCalls int
+}
+
+func (cb *countingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.Object, error) {
+	cb.statCalls++
+	return cb.Bucket.StatObject(ctx, req)
+}
+
+// persistentStatCacheTest exercises gcscaching.PersistentStatCache directly
+// against the on-disk file, rather than through a mounted file system, so
+// that it can open independent cache handles against the same path to
+// simulate successive mounts without needing to tear down and recreate the
+// FUSE mount itself.
+type persistentStatCacheTest struct {
+	cachingTestCommon
+	cacheDir string
+}
+
+func init() { registerSuitePrototype(&persistentStatCacheTest{}) }
+
+func (t *persistentStatCacheTest) setUpFSTest(cfg FSTestConfig) {
+	var err error
+	t.cacheDir, err = ioutil.TempDir("", "gcsfuse_persistent_stat_cache")
+	AssertEq(nil, err)
+
+	t.cachingTestCommon.setUpFSTest(cfg)
+}
+
+func (t *persistentStatCacheTest) cachePath() string {
+	return path.Join(t.cacheDir, "stat_cache.db")
+}
+
+func (t *persistentStatCacheTest) SurvivesRemount() {
+	const name = "foo"
+
+	// Create an object in GCS.
+	_, err := gcsutil.CreateObject(t.ctx, t.uncachedBucket, name, "taco")
+	AssertEq(nil, err)
+
+	// Open a persistent cache and warm it with a stat of the object, as a
+	// fresh mount would on first access.
+	spy := &countingBucket{Bucket: t.uncachedBucket}
+
+	cacheA, err := gcscaching.NewPersistentStatCache(t.cachePath(), t.bucket.Name(), 1000)
+	AssertEq(nil, err)
+
+	bucketA := gcscaching.NewFastStatBucket(ttl, cacheA, t.clock, spy)
+
+	_, err = bucketA.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	ExpectEq(1, spy.statCalls)
+
+	AssertEq(nil, cacheA.Close())
+
+	// Simulate a remount: open a brand new persistent cache backed by the
+	// same file and a brand new FastStatBucket. The warm entry is read back
+	// from disk, but a fresh FastStatBucket has no record of ever having
+	// fetched it itself, so it validates the entry once against GCS before
+	// trusting it -- one more call against the spy, not zero.
+	cacheB, err := gcscaching.NewPersistentStatCache(t.cachePath(), t.bucket.Name(), 1000)
+	AssertEq(nil, err)
+	defer cacheB.Close()
+
+	bucketB := gcscaching.NewFastStatBucket(ttl, cacheB, t.clock, spy)
+
+	_, err = bucketB.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	ExpectEq(2, spy.statCalls)
+}
+
+func (t *persistentStatCacheTest) DetectsStaleEntryOnFirstAccess() {
+	const name = "foo"
+
+	_, err := gcsutil.CreateObject(t.ctx, t.uncachedBucket, name, "taco")
+	AssertEq(nil, err)
+
+	spy := &countingBucket{Bucket: t.uncachedBucket}
+
+	cacheA, err := gcscaching.NewPersistentStatCache(t.cachePath(), t.bucket.Name(), 1000)
+	AssertEq(nil, err)
+
+	bucketA := gcscaching.NewFastStatBucket(ttl, cacheA, t.clock, spy)
+
+	_, err = bucketA.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	AssertEq(nil, cacheA.Close())
+
+	// Mutate the object out from under the cache while it's closed.
+	_, err = gcsutil.CreateObject(t.ctx, t.uncachedBucket, name, "burrito")
+	AssertEq(nil, err)
+
+	// A fresh cache reading the now-stale on-disk entry should notice the
+	// generation mismatch on its first access and fall through to GCS.
+	cacheB, err := gcscaching.NewPersistentStatCache(t.cachePath(), t.bucket.Name(), 1000)
+	AssertEq(nil, err)
+	defer cacheB.Close()
+
+	bucketB := gcscaching.NewFastStatBucket(ttl, cacheB, t.clock, spy)
+
+	o, err := bucketB.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	ExpectEq(2, spy.statCalls)
+	ExpectEq(len("burrito"), o.Size)
+}
+
+func (t *persistentStatCacheTest) DetectsNegativeEntryCreatedWhileUnmounted() {
+	const name = "foo"
+
+	spy := &countingBucket{Bucket: t.uncachedBucket}
+
+	cacheA, err := gcscaching.NewPersistentStatCache(t.cachePath(), t.bucket.Name(), 1000)
+	AssertEq(nil, err)
+
+	bucketA := gcscaching.NewFastStatBucket(ttl, cacheA, t.clock, spy)
+	bucketA.SetNegativeTTL(time.Hour)
+
+	// Warm a negative entry: the object doesn't exist yet.
+	_, err = bucketA.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	_, notFound := err.(*gcs.NotFoundError)
+	AssertTrue(notFound, "err: %v", err)
+	AssertEq(nil, cacheA.Close())
+
+	// Create the object out from under the cache while it's closed.
+	_, err = gcsutil.CreateObject(t.ctx, t.uncachedBucket, name, "taco")
+	AssertEq(nil, err)
+
+	// A fresh cache reading the now-stale negative entry should notice the
+	// object now exists on its first access, rather than trusting the
+	// negative entry until negativeTTL elapses.
+	cacheB, err := gcscaching.NewPersistentStatCache(t.cachePath(), t.bucket.Name(), 1000)
+	AssertEq(nil, err)
+	defer cacheB.Close()
+
+	bucketB := gcscaching.NewFastStatBucket(ttl, cacheB, t.clock, spy)
+	bucketB.SetNegativeTTL(time.Hour)
+
+	o, err := bucketB.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	ExpectEq(len("taco"), o.Size)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Context cancellation
+////////////////////////////////////////////////////////////////////////
+
+// blockingBucket wraps a gcs.Bucket, blocking each StatObject call until the
+// request's context is done and then returning ctx.Err(). It stands in for
+// a slow GCS RPC so tests can assert that cancelling a FUSE op's context
+// actually cancels the in-flight call, rather than letting it run to
+// completion.
+type blockingBucket struct {
+	gcs.Bucket
+}
+
+func (bb *blockingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.Object, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// contextCancellationTest proves that the caching bucket wrappers pass the
+// caller's context straight through to the underlying bucket instead of
+// starting a fresh background one, so that cancelling the context derived
+// from a FUSE op (e.g. on client interrupt) aborts the in-flight GCS RPC.
+// inode.DirInode threads that same ctx the rest of the way through
+// LookUpChild, ReadEntries, and StatObject (see fs/inode/dir_inode.go); this
+// suite covers the caching layer's half of the contract in isolation, since
+// driving cancellation through a full mounted file system is much harder to
+// make deterministic.
+type contextCancellationTest struct {
+	cachingTestCommon
+}
+
+func init() { registerSuitePrototype(&contextCancellationTest{}) }
+
+func (t *contextCancellationTest) CancelingContextAbortsInFlightStat() {
+	statCache := gcscaching.NewStatCache(1000)
+	bucket := gcscaching.NewFastStatBucket(
+		ttl,
+		statCache,
+		t.clock,
+		&blockingBucket{Bucket: t.uncachedBucket})
+
+	ctx, cancel := context.WithCancel(t.ctx)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "foo"})
+		done <- err
+	}()
+
+	// Give the goroutine a moment to reach the blocking call, then cancel.
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		ExpectEq(context.Canceled, err)
+	case <-time.After(time.Second):
+		AssertTrue(false, "StatObject did not return promptly after cancellation")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// Revalidation against a soft TTL
+////////////////////////////////////////////////////////////////////////
+
+const softTTL = ttl / 2
+
+// revalidatedStatCacheTest exercises gcscaching.NewRevalidatingFastStatBucket
+// directly against a countingBucket spy, the same way persistentStatCacheTest
+// exercises the persistent cache: past the soft TTL, a stat issues a full
+// re-stat against the wrapped bucket and compares generations client-side,
+// rather than blindly trusting the entry until the hard TTL. This costs the
+// same one request as any other stat -- gcs.Bucket has no conditional
+// request primitive to make an unchanged-object check cheaper -- so what it
+// buys is fresher data sooner, not fewer round trips.
+type revalidatedStatCacheTest struct {
+	cachingTestCommon
+}
+
+func init() { registerSuitePrototype(&revalidatedStatCacheTest{}) }
+
+func (t *revalidatedStatCacheTest) RevalidatedWithinTTL() {
+	if t.simulatedClock == nil {
+		log.Println("Test requires a simulated clock; skipping.")
+		return
+	}
+
+	const name = "foo"
+	_, err := gcsutil.CreateObject(t.ctx, t.uncachedBucket, name, "taco")
+	AssertEq(nil, err)
+
+	spy := &countingBucket{Bucket: t.uncachedBucket}
+	statCache := gcscaching.NewStatCache(1000)
+	bucket := gcscaching.NewRevalidatingFastStatBucket(
+		ttl,
+		softTTL,
+		statCache,
+		t.simulatedClock,
+		spy)
+
+	o, err := bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	ExpectEq(len("taco"), o.Size)
+	ExpectEq(1, spy.statCalls)
+
+	// Advance past the soft TTL, but not the hard one, and mutate the object
+	// remotely.
+	t.simulatedClock.AdvanceTime(softTTL + time.Millisecond)
+
+	_, err = gcsutil.CreateObject(t.ctx, t.uncachedBucket, name, "burrito")
+	AssertEq(nil, err)
+
+	// The revalidation should notice the generation mismatch and refresh the
+	// entry, at the cost of one extra round trip.
+	o, err = bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	ExpectEq(len("burrito"), o.Size)
+	ExpectEq(2, spy.statCalls)
+
+	// A further stat, still within the renewed soft TTL, should be served
+	// straight from cache with no further round trip.
+	o, err = bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	ExpectEq(len("burrito"), o.Size)
+	ExpectEq(2, spy.statCalls)
+}
+
+func (t *revalidatedStatCacheTest) UnchangedObjectIsRevalidatedWithOneStat() {
+	if t.simulatedClock == nil {
+		log.Println("Test requires a simulated clock; skipping.")
+		return
+	}
+
+	const name = "foo"
+	_, err := gcsutil.CreateObject(t.ctx, t.uncachedBucket, name, "taco")
+	AssertEq(nil, err)
+
+	spy := &countingBucket{Bucket: t.uncachedBucket}
+	statCache := gcscaching.NewStatCache(1000)
+	bucket := gcscaching.NewRevalidatingFastStatBucket(
+		ttl,
+		softTTL,
+		statCache,
+		t.simulatedClock,
+		spy)
+
+	_, err = bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	ExpectEq(1, spy.statCalls)
+
+	t.simulatedClock.AdvanceTime(softTTL + time.Millisecond)
+
+	// The object hasn't changed, so the revalidating stat finds the same
+	// generation and the entry's expiry is simply renewed. This still costs
+	// one full stat against the spy -- the same as any other stat, not a
+	// cheaper conditional request -- just one we'd have paid anyway had the
+	// object actually changed.
+	o, err := bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	ExpectEq(len("taco"), o.Size)
+	ExpectEq(2, spy.statCalls)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Negative stat caching
+////////////////////////////////////////////////////////////////////////
+
+// negativeStatCacheTest exercises FastStatBucket.SetNegativeTTL directly
+// against a countingBucket spy, the same way revalidatedStatCacheTest
+// exercises revalidation: it counts how many GCS requests repeated misses
+// on the same name actually cause once negative caching is enabled.
+type negativeStatCacheTest struct {
+	cachingTestCommon
+}
+
+func init() { registerSuitePrototype(&negativeStatCacheTest{}) }
+
+func (t *negativeStatCacheTest) RepeatedStatsOnMissingNameHitGCSOnce() {
+	const name = ".git"
+
+	spy := &countingBucket{Bucket: t.uncachedBucket}
+	statCache := gcscaching.NewStatCache(1000)
+	bucket := gcscaching.NewFastStatBucket(ttl, statCache, t.clock, spy)
+	bucket.SetNegativeTTL(ttl)
+
+	// The first stat of a name that doesn't exist has to ask GCS.
+	_, err := bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	_, notFound := err.(*gcs.NotFoundError)
+	AssertTrue(notFound, "err: %v", err)
+
+	callsAfterFirstMiss := spy.statCalls
+	ExpectGe(callsAfterFirstMiss, 1)
+
+	// Editors and the like probe the same missing name repeatedly (.swp,
+	// .git, and so on); within the negative TTL, none of those should
+	// generate another GCS request.
+	for i := 0; i < 5; i++ {
+		_, err = bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+		_, notFound = err.(*gcs.NotFoundError)
+		ExpectTrue(notFound, "err: %v", err)
+	}
+
+	ExpectEq(callsAfterFirstMiss, spy.statCalls)
+}
+
+func (t *negativeStatCacheTest) NegativeEntryExpiresAfterTTL() {
+	if t.simulatedClock == nil {
+		log.Println("Test requires a simulated clock; skipping.")
+		return
+	}
+
+	const name = "foo"
+
+	spy := &countingBucket{Bucket: t.uncachedBucket}
+	statCache := gcscaching.NewStatCache(1000)
+	bucket := gcscaching.NewFastStatBucket(ttl, statCache, t.simulatedClock, spy)
+	bucket.SetNegativeTTL(ttl)
+
+	// Stat the name before it exists, populating a negative entry.
+	_, err := bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	_, notFound := err.(*gcs.NotFoundError)
+	AssertTrue(notFound, "err: %v", err)
+
+	// Create the backing object out of band.
+	_, err = gcsutil.CreateObject(t.ctx, t.uncachedBucket, name, "taco")
+	AssertEq(nil, err)
+
+	// Because we're caching the miss, it should still appear to be absent.
+	_, err = bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	_, notFound = err.(*gcs.NotFoundError)
+	AssertTrue(notFound, "err: %v", err)
+
+	// After the negative TTL elapses, the object should appear.
+	t.simulatedClock.AdvanceTime(ttl + time.Millisecond)
+
+	o, err := bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	AssertEq(nil, err)
+	ExpectEq(len("taco"), o.Size)
+}
+
+// NegativeEntryInvalidatedWhenObjectIsCreated proves the other half of the
+// negative caching acceptance criteria: a negative entry doesn't have to
+// wait out its TTL if a change notification reports the name before then.
+// StatCache.Erase doesn't distinguish positive from negative entries, so
+// the same ListenForChanges wiring cachingWithNotifierTest exercises for
+// positive entries invalidates a negative one too -- this just proves that
+// composition holds for the negative-caching path as well.
+func (t *negativeStatCacheTest) NegativeEntryInvalidatedWhenObjectIsCreated() {
+	const name = "foo"
+
+	spy := &countingBucket{Bucket: t.uncachedBucket}
+	statCache := gcscaching.NewStatCache(1000)
+	bucket := gcscaching.NewFastStatBucket(ttl, statCache, t.clock, spy)
+	bucket.SetNegativeTTL(ttl)
+
+	n := newFakeNotifier()
+	AssertEq(nil, bucket.ListenForChanges(t.ctx, n))
+
+	// Stat the name before it exists, populating a negative entry well
+	// within the negative TTL.
+	_, err := bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	_, notFound := err.(*gcs.NotFoundError)
+	AssertTrue(notFound, "err: %v", err)
+
+	// Create the backing object out of band, then notify as a real GCS
+	// Object Change Notification would.
+	_, err = gcsutil.CreateObject(t.ctx, t.uncachedBucket, name, "taco")
+	AssertEq(nil, err)
+
+	n.Notify(name)
+
+	o, err := awaitStatObject(bucket, t.ctx, name, func(o *gcs.Object, err error) bool {
+		return err == nil && o.Size == int64(len("taco"))
+	})
+
+	AssertEq(nil, err)
+	ExpectEq(len("taco"), o.Size)
+}
@@ -0,0 +1,190 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inode implements the directory- and file-level abstractions the
+// fs package mounts. This file covers DirInode's GCS-facing reads; it does
+// not attempt to reconstruct the rest of the package (file content,
+// symlinks, renaming, and so on).
+package inode
+
+import (
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/gcscaching"
+	"github.com/googlecloudplatform/gcsfuse/timeutil"
+	"github.com/jacobsa/gcloud/gcs"
+	"golang.org/x/net/context"
+)
+
+// ConflictingFileNameSuffix is appended to a name to disambiguate a file
+// from a directory that share the same name in the backing bucket.
+const ConflictingFileNameSuffix = "\x1f"
+
+// Entry is a single immediate child of a directory, as reported by
+// LookUpChild or ReadEntries.
+type Entry struct {
+	Name   string
+	Object *gcs.Object
+}
+
+// DirInode represents a directory backed by a GCS bucket. Every method
+// takes a context.Context derived from the FUSE op that triggered it and
+// passes it straight through to the bucket, so that cancelling that op
+// (e.g. because the kernel gave up waiting, or the calling process was
+// interrupted) cancels the in-flight GCS request instead of letting it run
+// to completion.
+//
+// DirInode has no mutable state of its own beyond the caches passed in at
+// construction time (gcs.Bucket and gcscaching.TypeCache are both already
+// safe for concurrent use), so it needs no lock of its own.
+type DirInode struct {
+	bucket gcs.Bucket
+	name   string // the directory's object name, e.g. "foo/bar/"
+
+	clock timeutil.Clock
+
+	// typeCache records whether a child name was last found to be a regular
+	// file or a directory placeholder, so that a repeat LookUpChild for the
+	// same name doesn't have to stat both forms again. Entries are trusted
+	// for typeCacheTTL.
+	typeCache    gcscaching.TypeCache
+	typeCacheTTL time.Duration
+}
+
+// NewDirInode creates a directory inode backed by the object name within
+// bucket. typeCache and typeCacheTTL back the file-vs-directory
+// disambiguation LookUpChild performs; pass a typeCache sized for the
+// expected number of live child names (gcscaching.NewTypeCache's capacity
+// is unbounded if non-positive, which risks unbounded growth over a
+// long-running mount rather than disabling caching).
+func NewDirInode(
+	name string,
+	bucket gcs.Bucket,
+	typeCache gcscaching.TypeCache,
+	typeCacheTTL time.Duration,
+	clock timeutil.Clock) *DirInode {
+	return &DirInode{
+		bucket:       bucket,
+		name:         name,
+		clock:        clock,
+		typeCache:    typeCache,
+		typeCacheTTL: typeCacheTTL,
+	}
+}
+
+// LookUpChild stats the object backing the named child of d, honoring ctx:
+// if ctx is cancelled before the underlying StatObject call completes,
+// LookUpChild returns ctx.Err() promptly rather than waiting for the call
+// to run to completion.
+//
+// A name in this bucket may be backed by a regular object (a file), by a
+// directory placeholder object whose name ends in "/", or both (a
+// conflict, disambiguated elsewhere via ConflictingFileNameSuffix). Since
+// telling which requires statting both forms, the result is cached in
+// d.typeCache so that repeat lookups of the same name cost one stat
+// instead of two.
+func (d *DirInode) LookUpChild(
+	ctx context.Context,
+	name string) (*Entry, error) {
+	now := d.clock.Now()
+
+	if t, ok := d.typeCache.LookUp(name, now); ok {
+		return d.statChildAs(ctx, name, t == gcscaching.DirectoryType)
+	}
+
+	if entry, err := d.statChildAs(ctx, name, false); err == nil {
+		d.typeCache.Insert(name, gcscaching.RegularFileType, now.Add(d.typeCacheTTL))
+		return entry, nil
+	} else if _, notFound := err.(*gcs.NotFoundError); !notFound {
+		return nil, err
+	}
+
+	entry, err := d.statChildAs(ctx, name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	d.typeCache.Insert(name, gcscaching.DirectoryType, now.Add(d.typeCacheTTL))
+	return entry, nil
+}
+
+// statChildAs stats the object backing name, as a directory placeholder
+// (trailing "/") if dir is set and as a regular object otherwise.
+func (d *DirInode) statChildAs(
+	ctx context.Context,
+	name string,
+	dir bool) (*Entry, error) {
+	objectName := d.name + name
+	if dir {
+		objectName += "/"
+	}
+
+	o, err := d.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: objectName})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Entry{Name: name, Object: o}, nil
+}
+
+// ReadEntries lists the objects directly inside d, honoring ctx the same way
+// LookUpChild does. It follows the listing's continuation token until GCS
+// reports the listing is complete, so directories with more objects than
+// fit in a single page are still listed in full. Only listed objects are
+// returned: subdirectories, which the "/"-delimited listing reports as
+// collapsed prefixes rather than objects, are not included, and neither is
+// d's own placeholder object.
+func (d *DirInode) ReadEntries(ctx context.Context) ([]Entry, error) {
+	var entries []Entry
+	var tok string
+
+	for {
+		listing, err := d.bucket.ListObjects(
+			ctx,
+			&gcs.ListObjectsRequest{
+				Prefix:            d.name,
+				Delimiter:         "/",
+				ContinuationToken: tok,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, o := range listing.Objects {
+			if o.Name == d.name {
+				continue
+			}
+
+			entries = append(entries, Entry{
+				Name:   strings.TrimPrefix(o.Name, d.name),
+				Object: o,
+			})
+		}
+
+		if listing.ContinuationToken == "" {
+			break
+		}
+		tok = listing.ContinuationToken
+	}
+
+	return entries, nil
+}
+
+// StatObject stats the placeholder object backing d itself, honoring ctx
+// the same way LookUpChild does.
+func (d *DirInode) StatObject(ctx context.Context) (*gcs.Object, error) {
+	return d.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: d.name})
+}
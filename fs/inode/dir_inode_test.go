@@ -0,0 +1,243 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/gcscaching"
+	"github.com/googlecloudplatform/gcsfuse/timeutil"
+	"github.com/jacobsa/gcloud/gcs"
+	. "github.com/jacobsa/ogletest"
+	"golang.org/x/net/context"
+)
+
+func TestOgletest(t *testing.T) { RunTests(t) }
+
+// fakeBucket is a minimal gcs.Bucket, just enough to drive DirInode in
+// isolation: StatObject against a fixed set of objects, and ListObjects
+// against a fixed sequence of pages keyed by continuation token.
+type fakeBucket struct {
+	gcs.Bucket
+
+	mu        sync.Mutex
+	statCalls int
+	objects   map[string]*gcs.Object
+	listPages map[string]*gcs.Listing
+}
+
+func (b *fakeBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.Object, error) {
+	b.mu.Lock()
+	b.statCalls++
+	o, ok := b.objects[req.Name]
+	b.mu.Unlock()
+
+	if !ok {
+		return nil, &gcs.NotFoundError{
+			Err: fmt.Errorf("object %q not found", req.Name),
+		}
+	}
+
+	return o, nil
+}
+
+func (b *fakeBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	page, ok := b.listPages[req.ContinuationToken]
+	if !ok {
+		return &gcs.Listing{}, nil
+	}
+
+	return page, nil
+}
+
+// blockingBucket wraps a gcs.Bucket, blocking each call until the request's
+// context is done and then returning ctx.Err(), standing in for a slow GCS
+// RPC so tests can assert that DirInode passes ctx through rather than
+// starting a fresh background one.
+type blockingBucket struct {
+	gcs.Bucket
+}
+
+func (b *blockingBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.Object, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b *blockingBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func newTestClock() *timeutil.SimulatedClock {
+	return timeutil.NewSimulatedClock(time.Now())
+}
+
+////////////////////////////////////////////////////////////////////////
+// LookUpChild
+////////////////////////////////////////////////////////////////////////
+
+type DirInodeTest struct {
+}
+
+func init() { RegisterTestSuite(&DirInodeTest{}) }
+
+func (t *DirInodeTest) LookUpChild_CachesDirectoryTypeAcrossCalls() {
+	clock := newTestClock()
+	bucket := &fakeBucket{
+		objects: map[string]*gcs.Object{
+			"dir/sub/": {Name: "dir/sub/"},
+		},
+	}
+
+	d := inode.NewDirInode("dir/", bucket, gcscaching.NewTypeCache(10), time.Minute, clock)
+
+	// First lookup: the name's type isn't known yet, so it costs a stat of
+	// the file form (a miss) followed by a stat of the directory form (a
+	// hit).
+	entry, err := d.LookUpChild(context.Background(), "sub")
+	AssertEq(nil, err)
+	ExpectEq("sub", entry.Name)
+
+	bucket.mu.Lock()
+	ExpectEq(2, bucket.statCalls)
+	bucket.mu.Unlock()
+
+	// Second lookup: the type cache already knows "sub" is a directory, so
+	// this costs exactly one stat.
+	_, err = d.LookUpChild(context.Background(), "sub")
+	AssertEq(nil, err)
+
+	bucket.mu.Lock()
+	ExpectEq(3, bucket.statCalls)
+	bucket.mu.Unlock()
+}
+
+func (t *DirInodeTest) LookUpChild_RegularFileNeedsOnlyOneStat() {
+	clock := newTestClock()
+	bucket := &fakeBucket{
+		objects: map[string]*gcs.Object{
+			"dir/foo": {Name: "dir/foo", Size: 4},
+		},
+	}
+
+	d := inode.NewDirInode("dir/", bucket, gcscaching.NewTypeCache(10), time.Minute, clock)
+
+	entry, err := d.LookUpChild(context.Background(), "foo")
+	AssertEq(nil, err)
+	ExpectEq("foo", entry.Name)
+	ExpectEq(4, entry.Object.Size)
+
+	bucket.mu.Lock()
+	ExpectEq(1, bucket.statCalls)
+	bucket.mu.Unlock()
+}
+
+func (t *DirInodeTest) LookUpChild_NeitherFormExists() {
+	clock := newTestClock()
+	bucket := &fakeBucket{objects: map[string]*gcs.Object{}}
+
+	d := inode.NewDirInode("dir/", bucket, gcscaching.NewTypeCache(10), time.Minute, clock)
+
+	_, err := d.LookUpChild(context.Background(), "missing")
+	_, notFound := err.(*gcs.NotFoundError)
+	ExpectTrue(notFound, "err: %v", err)
+}
+
+func (t *DirInodeTest) LookUpChild_HonorsContextCancellation() {
+	clock := newTestClock()
+	d := inode.NewDirInode("dir/", &blockingBucket{}, gcscaching.NewTypeCache(10), time.Minute, clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := d.LookUpChild(ctx, "foo")
+		done <- err
+	}()
+
+	// Give the goroutine a moment to reach the blocking call, then cancel.
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		ExpectEq(context.Canceled, err)
+	case <-time.After(time.Second):
+		AssertTrue(false, "LookUpChild did not return promptly after cancellation")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// ReadEntries
+////////////////////////////////////////////////////////////////////////
+
+func (t *DirInodeTest) ReadEntries_FollowsContinuationToken() {
+	clock := newTestClock()
+	bucket := &fakeBucket{
+		listPages: map[string]*gcs.Listing{
+			"": {
+				Objects:           []*gcs.Object{{Name: "dir/a"}},
+				ContinuationToken: "page2",
+			},
+			"page2": {
+				Objects: []*gcs.Object{{Name: "dir/b"}, {Name: "dir/c"}},
+			},
+		},
+	}
+
+	d := inode.NewDirInode("dir/", bucket, gcscaching.NewTypeCache(10), time.Minute, clock)
+
+	entries, err := d.ReadEntries(context.Background())
+	AssertEq(nil, err)
+	AssertEq(3, len(entries))
+	ExpectEq("a", entries[0].Name)
+	ExpectEq("b", entries[1].Name)
+	ExpectEq("c", entries[2].Name)
+}
+
+func (t *DirInodeTest) ReadEntries_HonorsContextCancellation() {
+	clock := newTestClock()
+	d := inode.NewDirInode("dir/", &blockingBucket{}, gcscaching.NewTypeCache(10), time.Minute, clock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := d.ReadEntries(ctx)
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		ExpectEq(context.Canceled, err)
+	case <-time.After(time.Second):
+		AssertTrue(false, "ReadEntries did not return promptly after cancellation")
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/gcscaching/notifier"
+	"github.com/googlecloudplatform/gcsfuse/timeutil"
+	"github.com/jacobsa/gcloud/gcs"
+)
+
+// ServerConfig controls the behavior of a gcsfuse mount.
+type ServerConfig struct {
+	// The bucket that the file system mounts. Callers that want caching
+	// should wrap it (e.g. with gcscaching.NewFastStatBucket) before
+	// setting this field.
+	Bucket gcs.Bucket
+
+	// The clock used for cache TTL bookkeeping.
+	Clock timeutil.Clock
+
+	// Whether to treat GCS objects whose parent directory has no backing
+	// placeholder object as implicit directories.
+	ImplicitDirectories bool
+
+	// How long to trust the directory type cache (file vs. directory vs.
+	// symlink) for a given name before re-statting it.
+	DirTypeCacheTTL time.Duration
+
+	// A subscription to GCS Object Change Notifications for the mounted
+	// bucket, whose events can invalidate stat cache entries before their
+	// TTL (see gcscaching.FastStatBucket.ListenForChanges). The server does
+	// not subscribe to it: setting this field alone changes no caching.
+	Notifier notifier.Notifier
+
+	// The path to a file backing a persistent on-disk stat cache (see
+	// gcscaching.PersistentStatCache), for a cache that survives a remount.
+	// The server does not open a cache at this path: Bucket caches only
+	// through whatever wrapper the caller built it with.
+	StatCachePath string
+
+	// How long to cache ENOENT results for a given name, so that repeated
+	// stats of a nonexistent name (editors probing .swp, .git, and the like)
+	// don't each cost a GCS round trip (see
+	// gcscaching.FastStatBucket.SetNegativeTTL). The server does not apply
+	// this value to Bucket: setting this field alone changes no caching.
+	StatCacheNegativeTTL time.Duration
+}
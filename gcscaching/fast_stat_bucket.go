@@ -0,0 +1,277 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcscaching
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/gcscaching/notifier"
+	"github.com/googlecloudplatform/gcsfuse/timeutil"
+	"github.com/jacobsa/gcloud/gcs"
+	"golang.org/x/net/context"
+)
+
+// FastStatBucket is a gcs.Bucket that wraps another bucket, serving
+// StatObject requests out of a StatCache when possible rather than
+// forwarding them on.
+type FastStatBucket struct {
+	gcs.Bucket
+
+	clock timeutil.Clock
+	cache StatCache
+
+	// How long a cached positive entry lives in the cache before expiring,
+	// whether or not revalidation is configured.
+	hardTTL time.Duration
+
+	// If non-zero, entries last fetched more than softTTL ago are
+	// revalidated with a full stat against the backing bucket rather than
+	// being trusted until hardTTL, and the hard-TTL clock is reset each time
+	// such a stat finds the object unchanged.
+	softTTL time.Duration
+
+	// If non-zero, misses are cached as negative entries for this long.
+	negativeTTL time.Duration
+
+	mu sync.Mutex
+
+	// lastFetched records the last time *this* FastStatBucket fetched each
+	// name from the wrapped bucket. A name with no entry here is revalidated
+	// unconditionally on its next access even if the cache already has an
+	// unexpired hit for it, since that hit didn't come from anything we
+	// fetched ourselves -- most notably an entry warmed into a
+	// PersistentStatCache-backed StatCache from a previous mount's on-disk
+	// state, which must be checked against the bucket once before being
+	// trusted.
+	lastFetched map[string]time.Time
+}
+
+// NewFastStatBucket creates a bucket that caches StatObject results in
+// cache for ttl before re-consulting the wrapped bucket.
+func NewFastStatBucket(
+	ttl time.Duration,
+	cache StatCache,
+	clock timeutil.Clock,
+	bucket gcs.Bucket) *FastStatBucket {
+	return &FastStatBucket{
+		Bucket:      bucket,
+		clock:       clock,
+		cache:       cache,
+		hardTTL:     ttl,
+		lastFetched: make(map[string]time.Time),
+	}
+}
+
+// NewRevalidatingFastStatBucket is like NewFastStatBucket, but once an entry
+// is older than softTTL, a stat past that point issues a full StatObject
+// call against the wrapped bucket and compares the result's Generation and
+// MetaGeneration against the cached entry, instead of trusting the entry
+// outright. If they match, the entry's expiration is simply renewed; if
+// not, the cache is refreshed with the new metadata. Either way this costs
+// exactly one ordinary stat against the wrapped bucket -- gcs.Bucket has no
+// conditional-request primitive (e.g. If-Generation-Not-Match) to make that
+// cheaper, so the benefit over waiting out the full hardTTL is fresher data
+// sooner, not fewer or smaller requests.
+func NewRevalidatingFastStatBucket(
+	hardTTL time.Duration,
+	softTTL time.Duration,
+	cache StatCache,
+	clock timeutil.Clock,
+	bucket gcs.Bucket) *FastStatBucket {
+	b := NewFastStatBucket(hardTTL, cache, clock, bucket)
+	b.softTTL = softTTL
+	return b
+}
+
+// SetNegativeTTL enables caching of StatObject misses (gcs.NotFoundError)
+// for the given duration. The zero value, the default, disables negative
+// caching.
+func (b *FastStatBucket) SetNegativeTTL(ttl time.Duration) {
+	b.negativeTTL = ttl
+}
+
+// Eraser is the subset of a cache's interface that ListenForChanges needs in
+// order to invalidate an entry by name. Both StatCache and TypeCache
+// implement it.
+type Eraser interface {
+	Erase(name string)
+}
+
+// ListenForChanges subscribes to n and erases the stat cache entry for
+// whatever object name each event names, for as long as ctx is valid. It
+// also erases the entry under that same name from each of extra -- e.g. a
+// TypeCache, so that a change notification invalidates type information as
+// well as stat information. The name is used exactly as the event reports
+// it (e.g. "dir/foo" or "foo/"), with no translation to a directory-relative
+// child name: a DirInode's type cache, keyed by child name without the
+// directory prefix or a trailing "/", only loses its entry when the two
+// coincide, as for a regular file in the bucket root. This lets a cache
+// entry be invalidated as soon as a change notification arrives rather than
+// waiting out its TTL. It returns once the initial subscription succeeds;
+// delivery of events happens in the background.
+func (b *FastStatBucket) ListenForChanges(
+	ctx context.Context,
+	n notifier.Notifier,
+	extra ...Eraser) error {
+	events, err := n.Subscribe(ctx)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+
+				b.cache.Erase(e.Name)
+				for _, c := range extra {
+					c.Erase(e.Name)
+				}
+
+				b.mu.Lock()
+				delete(b.lastFetched, e.Name)
+				b.mu.Unlock()
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (b *FastStatBucket) shouldRevalidate(name string, now time.Time) bool {
+	b.mu.Lock()
+	last, fetchedByUs := b.lastFetched[name]
+	b.mu.Unlock()
+
+	// We haven't ourselves fetched this name from the wrapped bucket, so the
+	// cache entry didn't come from a stat we did -- e.g. it was warmed from a
+	// PersistentStatCache's on-disk state left over from a previous mount.
+	// Validate it against the bucket once before trusting it, regardless of
+	// whether soft-TTL revalidation is configured.
+	if !fetchedByUs {
+		return true
+	}
+
+	if b.softTTL == 0 {
+		return false
+	}
+
+	return now.Sub(last) >= b.softTTL
+}
+
+func (b *FastStatBucket) recordFetch(name string, now time.Time) {
+	b.mu.Lock()
+	b.lastFetched[name] = now
+	b.mu.Unlock()
+}
+
+func (b *FastStatBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (o *gcs.Object, err error) {
+	now := b.clock.Now()
+
+	cached, negative, ok := b.cache.LookUp(req.Name, now)
+	if ok && negative {
+		if !b.shouldRevalidate(req.Name, now) {
+			err = &gcs.NotFoundError{
+				Err: fmt.Errorf("object %q not found (cached)", req.Name),
+			}
+			return
+		}
+
+		// This negative entry is either past its soft TTL or one we didn't
+		// establish ourselves (e.g. warmed from a PersistentStatCache's
+		// on-disk state); the object may have been created in the meantime,
+		// so check before trusting it further.
+		o, err = b.Bucket.StatObject(ctx, req)
+
+		if _, notFound := err.(*gcs.NotFoundError); notFound {
+			b.recordFetch(req.Name, now)
+			if b.negativeTTL > 0 {
+				b.cache.InsertNegative(req.Name, now.Add(b.negativeTTL))
+			}
+			return
+		}
+
+		if err != nil {
+			// A transient error (e.g. a timeout) doesn't tell us anything about
+			// whether the object exists; leave the stale negative entry and its
+			// fetch record alone rather than recording a validation that didn't
+			// actually happen.
+			return
+		}
+
+		b.recordFetch(req.Name, now)
+		b.cache.Insert(o, now.Add(b.hardTTL))
+		return
+	}
+
+	if ok && !b.shouldRevalidate(req.Name, now) {
+		o = cached
+		return
+	}
+
+	if ok {
+		// Soft TTL has elapsed (or this is the first access to an entry we
+		// didn't fetch ourselves); re-stat and compare generations before
+		// trusting the entry further.
+		var fresh *gcs.Object
+		fresh, err = b.Bucket.StatObject(ctx, req)
+		if err != nil {
+			return
+		}
+
+		b.recordFetch(req.Name, now)
+
+		if fresh.Generation == cached.Generation &&
+			fresh.MetaGeneration == cached.MetaGeneration {
+			// Unchanged: just renew the hard TTL rather than swapping in an
+			// object we already have.
+			b.cache.Insert(cached, now.Add(b.hardTTL))
+			o = cached
+			return
+		}
+
+		b.cache.Insert(fresh, now.Add(b.hardTTL))
+		o = fresh
+		return
+	}
+
+	// Full miss: ask the wrapped bucket.
+	o, err = b.Bucket.StatObject(ctx, req)
+
+	if _, notFound := err.(*gcs.NotFoundError); notFound && b.negativeTTL > 0 {
+		b.cache.InsertNegative(req.Name, now.Add(b.negativeTTL))
+		b.recordFetch(req.Name, now)
+		return
+	}
+
+	if err != nil {
+		return
+	}
+
+	b.cache.Insert(o, now.Add(b.hardTTL))
+	b.recordFetch(req.Name, now)
+
+	return
+}
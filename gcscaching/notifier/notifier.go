@@ -0,0 +1,48 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notifier defines the interface gcscaching uses to learn about
+// out-of-band changes to objects in a bucket, so that cache entries can be
+// invalidated as soon as a change is reported rather than waiting out a
+// TTL.
+//
+// This package intentionally stops at the interface: a production
+// implementation backed by a real GCS Pub/Sub subscription needs an HTTP
+// and OAuth stack (e.g. cloud.google.com/go/pubsub) that nothing else in
+// this tree depends on or vendors, so wiring one up is left to whoever
+// brings in that dependency. What gcscaching does with a Notifier --
+// erasing the right cache entries for a reported name -- is real and
+// tested; see FastStatBucket.ListenForChanges. Tests in this package's
+// consumers drive the interface with a fake that pushes events directly.
+package notifier
+
+import (
+	"golang.org/x/net/context"
+)
+
+// Event describes a single reported change to an object.
+type Event struct {
+	// Name is the name of the object that changed, as it would appear in a
+	// gcs.Object.Name or a gcs.StatObjectRequest.Name.
+	Name string
+}
+
+// Notifier delivers Events for objects that have changed out from under a
+// cache, for as long as the supplied context is valid.
+type Notifier interface {
+	// Subscribe begins delivering events on the returned channel. The
+	// channel is closed when ctx is done or the subscription otherwise
+	// ends.
+	Subscribe(ctx context.Context) (<-chan Event, error)
+}
@@ -0,0 +1,269 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcscaching
+
+import (
+	"container/list"
+	"encoding/gob"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jacobsa/gcloud/gcs"
+)
+
+// persistentStatCacheKey identifies an entry by the bucket it came from as
+// well as the object name, so that two buckets sharing a single cache file
+// path don't collide with each other's entries.
+type persistentStatCacheKey struct {
+	BucketName string
+	Name       string
+}
+
+type persistentStatCacheEntry struct {
+	Key        persistentStatCacheKey
+	Object     *gcs.Object
+	Negative   bool
+	Expiration time.Time
+}
+
+// PersistentStatCache is a StatCache backed by a single on-disk file, so
+// that a warm cache survives a remount. It stores the full gcs.Object
+// metadata (including generation and meta-generation, so stale entries can
+// be detected) plus negative entries with their expiries, keyed by bucket
+// name plus object name.
+//
+// Entries are not re-validated against GCS on load; callers are expected to
+// validate lazily, e.g. by comparing the generation returned from the next
+// real StatObject call.
+//
+// Like statCache, PersistentStatCache is LRU-capacity-bounded: once full, an
+// Insert evicts the least recently used entry (possibly belonging to a
+// different bucket) before persisting, so a long-running mount's on-disk
+// cache doesn't grow without bound.
+//
+// Every write rewrites the whole file, so only one *PersistentStatCache*
+// handle should have a given path open at a time -- two live handles
+// sharing a path will stomp on each other's writes, last writer wins. The
+// bucket-name key only keeps entries of different buckets that use the same
+// *path* one after another (e.g. sequential remounts reusing one cache
+// file) from colliding with each other; it does not make concurrently open
+// handles on that path safe to use together.
+//
+// All methods are safe for concurrent use by callers sharing a single
+// handle.
+type PersistentStatCache struct {
+	mu sync.Mutex
+
+	path       string
+	bucketName string
+	capacity   int
+
+	entries map[persistentStatCacheKey]*list.Element // value is *persistentStatCacheEntry
+	order   *list.List                               // most recently used at the front
+}
+
+// NewPersistentStatCache opens (or creates) a persistent stat cache backed
+// by the file at path, warming its in-memory contents from whatever was
+// last persisted there. bucketName scopes every entry this handle inserts
+// or looks up, so that entries left behind by a previous mount of a
+// different bucket at the same path don't collide with this one's. capacity
+// bounds the number of entries kept across all buckets that have ever
+// shared path; a non-positive capacity means unbounded. See the
+// PersistentStatCache doc comment for why two handles must not have the
+// same path open at once.
+func NewPersistentStatCache(
+	path string,
+	bucketName string,
+	capacity int) (*PersistentStatCache, error) {
+	c := &PersistentStatCache{
+		path:       path,
+		bucketName: bucketName,
+		capacity:   capacity,
+		entries:    make(map[persistentStatCacheKey]*list.Element),
+		order:      list.New(),
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *PersistentStatCache) load() error {
+	f, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var entries []*persistentStatCacheEntry
+	if err := gob.NewDecoder(f).Decode(&entries); err != nil {
+		// An empty or partially-written file (e.g. from a crash mid-write)
+		// just means we start cold; anything else is a real error.
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		return err
+	}
+
+	// entries was written most-recently-used first; preserve that order.
+	for _, entry := range entries {
+		c.entries[entry.Key] = c.order.PushBack(entry)
+	}
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		c.evictOldestLocked()
+	}
+
+	return nil
+}
+
+// evictOldestLocked drops the least recently used entry. Callers must hold
+// c.mu and ensure the cache is non-empty.
+func (c *PersistentStatCache) evictOldestLocked() {
+	oldest := c.order.Back()
+	c.order.Remove(oldest)
+	delete(c.entries, oldest.Value.(*persistentStatCacheEntry).Key)
+}
+
+// persistLocked writes the current contents to disk via a temp file and
+// rename, so a crash mid-write never corrupts the existing cache file.
+// Callers must hold c.mu.
+func (c *PersistentStatCache) persistLocked() error {
+	entries := make([]*persistentStatCacheEntry, 0, c.order.Len())
+	for e := c.order.Front(); e != nil; e = e.Next() {
+		entries = append(entries, e.Value.(*persistentStatCacheEntry))
+	}
+
+	tmpPath := c.path + ".tmp"
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	if err := gob.NewEncoder(f).Encode(entries); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, c.path)
+}
+
+// insertLocked adds or replaces entry, evicting the least recently used
+// entry first if the cache is at capacity. Callers must hold c.mu.
+func (c *PersistentStatCache) insertLocked(entry *persistentStatCacheEntry) {
+	if elem, ok := c.entries[entry.Key]; ok {
+		c.order.Remove(elem)
+	}
+
+	c.entries[entry.Key] = c.order.PushFront(entry)
+
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		c.evictOldestLocked()
+	}
+}
+
+func (c *PersistentStatCache) Insert(o *gcs.Object, expiration time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.insertLocked(&persistentStatCacheEntry{
+		Key:        persistentStatCacheKey{BucketName: c.bucketName, Name: o.Name},
+		Object:     o,
+		Expiration: expiration,
+	})
+
+	if err := c.persistLocked(); err != nil {
+		log.Printf("gcscaching: failed to persist stat cache to %s: %v", c.path, err)
+	}
+}
+
+func (c *PersistentStatCache) InsertNegative(name string, expiration time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.insertLocked(&persistentStatCacheEntry{
+		Key:        persistentStatCacheKey{BucketName: c.bucketName, Name: name},
+		Negative:   true,
+		Expiration: expiration,
+	})
+
+	if err := c.persistLocked(); err != nil {
+		log.Printf("gcscaching: failed to persist stat cache to %s: %v", c.path, err)
+	}
+}
+
+func (c *PersistentStatCache) Erase(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := persistentStatCacheKey{BucketName: c.bucketName, Name: name}
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+
+	if err := c.persistLocked(); err != nil {
+		log.Printf("gcscaching: failed to persist stat cache to %s: %v", c.path, err)
+	}
+}
+
+func (c *PersistentStatCache) LookUp(
+	name string,
+	now time.Time) (o *gcs.Object, negative bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := persistentStatCacheKey{BucketName: c.bucketName, Name: name}
+	elem, present := c.entries[key]
+	if !present {
+		return
+	}
+
+	entry := elem.Value.(*persistentStatCacheEntry)
+	if !entry.Expiration.After(now) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return
+	}
+
+	c.order.MoveToFront(elem)
+
+	o = entry.Object
+	negative = entry.Negative
+	ok = true
+	return
+}
+
+// Close flushes the cache to disk. The cache remains otherwise usable after
+// Close returns; callers typically call Close only when tearing down the
+// mount that owns it.
+func (c *PersistentStatCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.persistLocked()
+}
@@ -0,0 +1,151 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcscaching
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/jacobsa/gcloud/gcs"
+)
+
+// StatCache is a cache from object name to either a record of the object's
+// metadata (a "positive" entry) or a record that no object with that name
+// existed as of some point in time (a "negative" entry). Entries expire
+// after the time supplied when they were inserted.
+//
+// All methods are safe for concurrent use.
+type StatCache interface {
+	// Insert records that o is current as of now, and should be trusted
+	// until expiration.
+	Insert(o *gcs.Object, expiration time.Time)
+
+	// InsertNegative records that no object named `name` existed as of now,
+	// and that fact should be trusted until expiration.
+	InsertNegative(name string, expiration time.Time)
+
+	// Erase removes any entry -- positive or negative -- for the given name.
+	Erase(name string)
+
+	// LookUp consults the cache for the given name as of now. If there is no
+	// unexpired entry, ok is false. Otherwise ok is true; if the entry is
+	// negative, negative is true and o is nil, and otherwise o is the cached
+	// record.
+	LookUp(name string, now time.Time) (o *gcs.Object, negative bool, ok bool)
+}
+
+type statCacheEntry struct {
+	name       string
+	object     *gcs.Object
+	negative   bool
+	expiration time.Time
+}
+
+// statCache is an LRU-capacity-bounded StatCache implementation.
+type statCache struct {
+	mu sync.Mutex
+
+	capacity int
+	entries  map[string]*list.Element // value is *statCacheEntry
+	order    *list.List               // most recently used at the front
+}
+
+// NewStatCache creates a new stat cache that holds at most the given number
+// of entries, evicting the least recently used entry once that capacity is
+// exceeded. A non-positive capacity means unbounded.
+func NewStatCache(capacity int) StatCache {
+	return &statCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (sc *statCache) insert(entry *statCacheEntry) {
+	if elem, ok := sc.entries[entry.name]; ok {
+		sc.order.Remove(elem)
+	}
+
+	sc.entries[entry.name] = sc.order.PushFront(entry)
+
+	for sc.capacity > 0 && sc.order.Len() > sc.capacity {
+		oldest := sc.order.Back()
+		if oldest == nil {
+			break
+		}
+
+		sc.order.Remove(oldest)
+		delete(sc.entries, oldest.Value.(*statCacheEntry).name)
+	}
+}
+
+func (sc *statCache) Insert(o *gcs.Object, expiration time.Time) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.insert(&statCacheEntry{
+		name:       o.Name,
+		object:     o,
+		expiration: expiration,
+	})
+}
+
+func (sc *statCache) InsertNegative(name string, expiration time.Time) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.insert(&statCacheEntry{
+		name:       name,
+		negative:   true,
+		expiration: expiration,
+	})
+}
+
+func (sc *statCache) Erase(name string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if elem, ok := sc.entries[name]; ok {
+		sc.order.Remove(elem)
+		delete(sc.entries, name)
+	}
+}
+
+func (sc *statCache) LookUp(
+	name string,
+	now time.Time) (o *gcs.Object, negative bool, ok bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	elem, present := sc.entries[name]
+	if !present {
+		return
+	}
+
+	entry := elem.Value.(*statCacheEntry)
+	if !entry.expiration.After(now) {
+		sc.order.Remove(elem)
+		delete(sc.entries, name)
+		return
+	}
+
+	sc.order.MoveToFront(elem)
+
+	o = entry.object
+	negative = entry.negative
+	ok = true
+	return
+}
@@ -0,0 +1,137 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcscaching
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ObjectType distinguishes what a directory listing found a given child
+// name to be, so that a directory inode doesn't have to stat both the file
+// and directory-placeholder forms of a name on every lookup.
+type ObjectType int
+
+const (
+	UnknownType ObjectType = iota
+	RegularFileType
+	DirectoryType
+	SymlinkType
+)
+
+// TypeCache is a cache from a child name to the ObjectType it was last
+// found to be, so that repeated lookups of the same name don't each have to
+// stat both the file and directory forms of the name. Entries expire after
+// the time supplied when they were inserted.
+//
+// All methods are safe for concurrent use.
+type TypeCache interface {
+	// Insert records that name was found to be of type t as of now, and
+	// that fact should be trusted until expiration.
+	Insert(name string, t ObjectType, expiration time.Time)
+
+	// Erase removes any entry for the given name.
+	Erase(name string)
+
+	// LookUp consults the cache for the given name as of now. If there is no
+	// unexpired entry, ok is false.
+	LookUp(name string, now time.Time) (t ObjectType, ok bool)
+}
+
+type typeCacheEntry struct {
+	name       string
+	t          ObjectType
+	expiration time.Time
+}
+
+// typeCache is an LRU-capacity-bounded TypeCache implementation, structured
+// the same way as statCache.
+type typeCache struct {
+	mu sync.Mutex
+
+	capacity int
+	entries  map[string]*list.Element // value is *typeCacheEntry
+	order    *list.List               // most recently used at the front
+}
+
+// NewTypeCache creates a new type cache that holds at most the given number
+// of entries, evicting the least recently used entry once that capacity is
+// exceeded. A non-positive capacity means unbounded.
+func NewTypeCache(capacity int) TypeCache {
+	return &typeCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (tc *typeCache) Insert(name string, t ObjectType, expiration time.Time) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if elem, ok := tc.entries[name]; ok {
+		tc.order.Remove(elem)
+	}
+
+	tc.entries[name] = tc.order.PushFront(&typeCacheEntry{
+		name:       name,
+		t:          t,
+		expiration: expiration,
+	})
+
+	for tc.capacity > 0 && tc.order.Len() > tc.capacity {
+		oldest := tc.order.Back()
+		if oldest == nil {
+			break
+		}
+
+		tc.order.Remove(oldest)
+		delete(tc.entries, oldest.Value.(*typeCacheEntry).name)
+	}
+}
+
+func (tc *typeCache) Erase(name string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if elem, ok := tc.entries[name]; ok {
+		tc.order.Remove(elem)
+		delete(tc.entries, name)
+	}
+}
+
+func (tc *typeCache) LookUp(name string, now time.Time) (t ObjectType, ok bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	elem, present := tc.entries[name]
+	if !present {
+		return
+	}
+
+	entry := elem.Value.(*typeCacheEntry)
+	if !entry.expiration.After(now) {
+		tc.order.Remove(elem)
+		delete(tc.entries, name)
+		return
+	}
+
+	tc.order.MoveToFront(elem)
+
+	t = entry.t
+	ok = true
+	return
+}